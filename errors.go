@@ -0,0 +1,122 @@
+package grsync
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// ErrAlreadyRunning is returned when a task is started while it's running already
+var ErrAlreadyRunning = errors.New("task is already running")
+
+// ErrNotRunning is returned when a task is paused or resumed while it isn't running
+var ErrNotRunning = errors.New("task is not running")
+
+// ErrNotPausable is returned by Task.Pause and Task.Resume unless
+// Task.SetPausable was enabled before the run
+var ErrNotPausable = errors.New("task is not pausable, see SetPausable")
+
+// ErrPauseUnsupported is returned by Task.Pause and Task.Resume on Windows,
+// which has no signals to stop a process
+var ErrPauseUnsupported = errors.New("pausing rsync is not supported on this platform")
+
+// exitCodeMeanings describes the exit codes documented in rsync(1)
+var exitCodeMeanings = map[int]string{
+	1:   "syntax or usage error",
+	2:   "protocol incompatibility",
+	3:   "errors selecting input/output files, dirs",
+	4:   "requested action not supported",
+	5:   "error starting client-server protocol",
+	6:   "daemon unable to append to log-file",
+	10:  "error in socket I/O",
+	11:  "error in file I/O",
+	12:  "error in rsync protocol data stream",
+	13:  "errors with program diagnostics",
+	14:  "error in IPC code",
+	20:  "received SIGUSR1 or SIGINT",
+	21:  "some error returned by waitpid()",
+	22:  "error allocating core memory buffers",
+	23:  "partial transfer due to error",
+	24:  "partial transfer due to vanished source files",
+	25:  "the --max-delete limit stopped deletions",
+	30:  "timeout in data send/receive",
+	35:  "timeout waiting for daemon connection",
+	255: "remote shell failed",
+}
+
+// Sentinels for the common exit codes. They match any RsyncError with the same
+// code, e.g. errors.Is(err, ErrVanishedFiles)
+var (
+	ErrSyntax           = &RsyncError{ExitCode: 1}
+	ErrProtocolIncompat = &RsyncError{ExitCode: 2}
+	ErrFileSelection    = &RsyncError{ExitCode: 3}
+	ErrUnsupported      = &RsyncError{ExitCode: 4}
+	ErrStartupProtocol  = &RsyncError{ExitCode: 5}
+	ErrSocketIO         = &RsyncError{ExitCode: 10}
+	ErrFileIO           = &RsyncError{ExitCode: 11}
+	ErrProtocolStream   = &RsyncError{ExitCode: 12}
+	ErrInterrupted      = &RsyncError{ExitCode: 20}
+	ErrPartialTransfer  = &RsyncError{ExitCode: 23}
+	ErrVanishedFiles    = &RsyncError{ExitCode: 24}
+	ErrMaxDelete        = &RsyncError{ExitCode: 25}
+	ErrTimeout          = &RsyncError{ExitCode: 30}
+	ErrConnectTimeout   = &RsyncError{ExitCode: 35}
+	ErrSSHConnection    = &RsyncError{ExitCode: 255}
+)
+
+// RsyncError is returned by Task when rsync exits with a non-zero code
+type RsyncError struct {
+	// ExitCode is rsync's exit status, -1 when it was terminated by a signal
+	ExitCode int
+	// Stderr is what rsync printed on stderr during the run
+	Stderr string
+
+	err error
+}
+
+// Error returns exit code with its meaning
+func (e *RsyncError) Error() string {
+	if e.ExitCode < 0 {
+		return fmt.Sprintf("rsync was stopped: %s", e.Meaning())
+	}
+
+	return fmt.Sprintf("rsync exited with code %d: %s", e.ExitCode, e.Meaning())
+}
+
+// Meaning returns a human-readable description of the exit code
+func (e *RsyncError) Meaning() string {
+	if meaning, ok := exitCodeMeanings[e.ExitCode]; ok {
+		return meaning
+	}
+
+	if e.err == nil {
+		return fmt.Sprintf("exit code %d", e.ExitCode)
+	}
+
+	return e.err.Error()
+}
+
+// Is reports whether target is the sentinel of the exit code
+func (e *RsyncError) Is(target error) bool {
+	sentinel, ok := target.(*RsyncError)
+	return ok && sentinel.err == nil && sentinel.ExitCode == e.ExitCode
+}
+
+// Unwrap returns the underlying *exec.ExitError
+func (e *RsyncError) Unwrap() error {
+	return e.err
+}
+
+// newRsyncError wraps exit errors into RsyncError, other errors are returned as is
+func newRsyncError(err error, stderr string) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+
+	return &RsyncError{
+		ExitCode: exitErr.ExitCode(),
+		Stderr:   stderr,
+		err:      err,
+	}
+}
@@ -0,0 +1,63 @@
+package grsync
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRsyncError(t *testing.T) {
+	t.Run("known exit code", func(t *testing.T) {
+		err := newRsyncError(exec.Command("sh", "-c", "exit 24").Run(), "file has vanished: \"/src/a\"\n")
+
+		rsyncErr := &RsyncError{}
+		assert.True(t, errors.As(err, &rsyncErr))
+		assert.Equal(t, 24, rsyncErr.ExitCode)
+		assert.Equal(t, "partial transfer due to vanished source files", rsyncErr.Meaning())
+		assert.Equal(t, "file has vanished: \"/src/a\"\n", rsyncErr.Stderr)
+		assert.Equal(t, "rsync exited with code 24: partial transfer due to vanished source files", err.Error())
+
+		exitErr := &exec.ExitError{}
+		assert.True(t, errors.As(err, &exitErr))
+	})
+
+	t.Run("unknown exit code", func(t *testing.T) {
+		err := newRsyncError(exec.Command("sh", "-c", "exit 42").Run(), "")
+		assert.Equal(t, "rsync exited with code 42: exit status 42", err.Error())
+		assert.Equal(t, "rsync exited with code 99: exit code 99", (&RsyncError{ExitCode: 99}).Error())
+	})
+
+	t.Run("sentinels", func(t *testing.T) {
+		err := newRsyncError(exec.Command("sh", "-c", "exit 24").Run(), "")
+
+		assert.True(t, errors.Is(err, ErrVanishedFiles))
+		assert.True(t, errors.Is(fmt.Errorf("backup failed: %w", err), ErrVanishedFiles))
+		assert.False(t, errors.Is(err, ErrPartialTransfer))
+		assert.False(t, errors.Is(ErrPartialTransfer, ErrVanishedFiles))
+		assert.Equal(t, "rsync exited with code 255: remote shell failed", ErrSSHConnection.Error())
+	})
+
+	t.Run("not an exit error", func(t *testing.T) {
+		original := errors.New("boom")
+		assert.Equal(t, original, newRsyncError(original, ""))
+	})
+}
+
+func TestRunTaskRsyncError(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "destDir")
+	createdTask := NewTask("a", dest, RsyncOptions{
+		RsyncBinaryPath: fakeRsync(t, "echo 'rsync: [sender] link_stat \"/a\" failed: No such file or directory (2)' >&2\nexit 23"),
+	})
+
+	err := createdTask.Run()
+
+	rsyncErr := &RsyncError{}
+	assert.True(t, errors.As(err, &rsyncErr))
+	assert.Equal(t, 23, rsyncErr.ExitCode)
+	assert.Contains(t, rsyncErr.Stderr, "link_stat")
+	assert.True(t, errors.Is(err, ErrPartialTransfer))
+}
@@ -0,0 +1,94 @@
+package grsync
+
+import "time"
+
+// EventType is a kind of Event
+type EventType int
+
+const (
+	// EventStarted is sent once rsync process has started
+	EventStarted EventType = iota
+	// EventProgress is sent every time State changes
+	EventProgress
+	// EventFileCompleted is sent when rsync finished transferring a file
+	EventFileCompleted
+	// EventError is sent for every error rsync reports on stderr
+	EventError
+	// EventFinished is sent once rsync has exited
+	EventFinished
+)
+
+// String returns name of the event type
+func (e EventType) String() string {
+	switch e {
+	case EventStarted:
+		return "Started"
+	case EventProgress:
+		return "Progress"
+	case EventFileCompleted:
+		return "FileCompleted"
+	case EventError:
+		return "Error"
+	case EventFinished:
+		return "Finished"
+	default:
+		return "Unknown"
+	}
+}
+
+// Event describes something which happened during a run
+type Event struct {
+	Type EventType
+	// State is a snapshot of the task state when the event happened
+	State State
+	// File is the completed file for EventFileCompleted
+	File string
+	// Message is the stderr line for EventError
+	Message string
+	// Err is the result of the run for EventFinished, nil on success
+	Err error
+}
+
+// OnEvent sets a callback receiving lifecycle events of the task; nil removes
+// it. The callback runs on the goroutines parsing rsync output without holding
+// the task lock, so it may call State or Log, but it should return quickly
+func (t *Task) OnEvent(handler func(Event)) {
+	t.mutex.Lock()
+	t.onEvent = handler
+	t.mutex.Unlock()
+}
+
+// emit delivers events to the handler. The caller must not hold the task mutex
+func (t *Task) emit(events ...Event) {
+	t.mutex.Lock()
+	handler := t.onEvent
+	t.mutex.Unlock()
+
+	if handler == nil {
+		return
+	}
+
+	for _, event := range events {
+		handler(event)
+	}
+}
+
+// FileResult describes a file rsync has finished transferring
+type FileResult struct {
+	Name string
+	// Size is the number of bytes transferred for the file. With
+	// --info=progress2 it is the growth of the overall counter since the
+	// previous file
+	Size int64
+	// Duration is the time from rsync printing the file name to it reporting
+	// the file done
+	Duration time.Duration
+}
+
+// OnFileComplete sets a callback receiving every file rsync finishes
+// transferring; nil removes it. Like OnEvent it runs without holding the task lock
+func (t *Task) OnFileComplete(handler func(FileResult)) {
+	t.mutex.Lock()
+	t.onFileComplete = handler
+	t.mutex.Unlock()
+}
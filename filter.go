@@ -0,0 +1,56 @@
+package grsync
+
+import "fmt"
+
+// FilterAction is the rule prefix of an rsync --filter rule
+type FilterAction string
+
+const (
+	// FilterInclude includes the matching files
+	FilterInclude FilterAction = "+"
+	// FilterExclude excludes the matching files
+	FilterExclude FilterAction = "-"
+	// FilterProtect protects the matching dest files from deletion
+	FilterProtect FilterAction = "P"
+	// FilterRisk undoes a protect rule, so the matching dest files can be deleted
+	FilterRisk FilterAction = "R"
+	// FilterHide hides the matching source files from the transfer
+	FilterHide FilterAction = "H"
+	// FilterShow undoes a hide rule, so the matching source files are transferred
+	FilterShow FilterAction = "S"
+	// FilterMerge reads more rules from the file named by the pattern
+	FilterMerge FilterAction = "."
+	// FilterDirMerge reads more rules from the file named by the pattern in every dir
+	FilterDirMerge FilterAction = ":"
+	// FilterClear clears the rules defined so far; it takes no pattern
+	FilterClear FilterAction = "!"
+)
+
+// FilterRule is a single rsync --filter rule, e.g. {FilterProtect, "/local/"}.
+// Modifiers are part of the action, e.g. "-/" matches the absolute path
+type FilterRule struct {
+	Action  FilterAction
+	Pattern string
+}
+
+// String returns the rule the way rsync reads it
+func (r FilterRule) String() string {
+	if r.Pattern == "" {
+		return string(r.Action)
+	}
+
+	return string(r.Action) + " " + r.Pattern
+}
+
+// validate reports rules missing their action or pattern
+func (r FilterRule) validate() error {
+	if r.Action == "" {
+		return fmt.Errorf("filter rule %q has no action", r.Pattern)
+	}
+
+	if r.Pattern == "" && r.Action != FilterClear {
+		return fmt.Errorf("filter rule %q has no pattern", r.Action)
+	}
+
+	return nil
+}
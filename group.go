@@ -0,0 +1,150 @@
+package grsync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TaskGroup runs several tasks concurrently and aggregates their state
+type TaskGroup struct {
+	tasks       []*Task
+	concurrency int
+}
+
+// GroupState contains the aggregated state of a TaskGroup. Counters and speed
+// are summed over all tasks, Progress is the mean of the tasks progress and ETA
+// and OverallETA are the longest ones
+type GroupState struct {
+	State
+	Tasks []State `json:"tasks"`
+}
+
+// GroupError is returned by TaskGroup.Run when some of the tasks failed
+type GroupError struct {
+	// Errors maps index of the failed task to its error
+	Errors map[int]error
+}
+
+// Error joins errors of all failed tasks
+func (e *GroupError) Error() string {
+	messages := []string{}
+	for _, index := range e.failed() {
+		messages = append(messages, fmt.Sprintf("task %d: %v", index, e.Errors[index]))
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap returns error of the first failed task
+func (e *GroupError) Unwrap() error {
+	failed := e.failed()
+	if len(failed) == 0 {
+		return nil
+	}
+
+	return e.Errors[failed[0]]
+}
+
+// failed returns sorted indexes of the failed tasks
+func (e *GroupError) failed() []int {
+	indexes := make([]int, 0, len(e.Errors))
+	for index := range e.Errors {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	return indexes
+}
+
+// NewTaskGroup returns group which runs at most concurrency tasks at once;
+// 0 runs all of them at once
+func NewTaskGroup(concurrency int, tasks ...*Task) *TaskGroup {
+	if concurrency <= 0 {
+		concurrency = len(tasks)
+	}
+
+	return &TaskGroup{
+		tasks:       tasks,
+		concurrency: concurrency,
+	}
+}
+
+// Run runs all tasks and waits for them to finish. A failing task doesn't stop
+// the others; cancelling ctx stops the running tasks and skips the pending
+// ones. When any task fails the returned error is *GroupError
+func (g *TaskGroup) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	errs := map[int]error{}
+	slots := make(chan struct{}, g.concurrency)
+
+	for index, task := range g.tasks {
+		wg.Add(1)
+		go func(index int, task *Task) {
+			defer wg.Done()
+
+			var err error
+			select {
+			case slots <- struct{}{}:
+				err = task.RunContext(ctx)
+				<-slots
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+
+			if err != nil {
+				mutex.Lock()
+				errs[index] = err
+				mutex.Unlock()
+			}
+		}(index, task)
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return &GroupError{Errors: errs}
+	}
+
+	return nil
+}
+
+// Tasks returns tasks of the group
+func (g *TaskGroup) Tasks() []*Task {
+	return g.tasks
+}
+
+// State returns aggregated information about the tasks of the group
+func (g *TaskGroup) State() GroupState {
+	state := GroupState{
+		Tasks: make([]State, 0, len(g.tasks)),
+	}
+
+	for _, task := range g.tasks {
+		taskState := task.State()
+		state.Tasks = append(state.Tasks, taskState)
+
+		state.Remain += taskState.Remain
+		state.Total += taskState.Total
+		state.Bytes += taskState.Bytes
+		state.TransferredFiles += taskState.TransferredFiles
+		state.Progress += taskState.Progress
+		state.SpeedBytesPerSec += taskState.SpeedBytesPerSec
+		if taskState.ETA > state.ETA {
+			state.ETA = taskState.ETA
+		}
+		if taskState.OverallETA > state.OverallETA {
+			state.OverallETA = taskState.OverallETA
+		}
+	}
+
+	if len(g.tasks) > 0 {
+		state.Progress /= float64(len(g.tasks))
+		state.Speed = formatSpeed(state.SpeedBytesPerSec)
+	}
+
+	return state
+}
@@ -0,0 +1,79 @@
+package grsync
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskGroupRun(t *testing.T) {
+	newTask := func(t *testing.T, script string) *Task {
+		return NewTask("a", filepath.Join(t.TempDir(), "destDir"), RsyncOptions{
+			RsyncBinaryPath: fakeRsync(t, script),
+		})
+	}
+
+	t.Run("all tasks succeed", func(t *testing.T) {
+		group := NewTaskGroup(2, newTask(t, "exit 0"), newTask(t, "exit 0"), newTask(t, "exit 0"))
+		assert.Nil(t, group.Run(context.Background()))
+	})
+
+	t.Run("failures are joined", func(t *testing.T) {
+		group := NewTaskGroup(0, newTask(t, "exit 0"), newTask(t, "exit 23"), newTask(t, "exit 24"))
+		err := group.Run(context.Background())
+
+		groupErr := &GroupError{}
+		assert.True(t, errors.As(err, &groupErr))
+		assert.Len(t, groupErr.Errors, 2)
+		assert.Contains(t, err.Error(), "task 1: rsync exited with code 23")
+		assert.Contains(t, err.Error(), "task 2: rsync exited with code 24")
+
+		rsyncErr := &RsyncError{}
+		assert.True(t, errors.As(err, &rsyncErr))
+		assert.Equal(t, 23, rsyncErr.ExitCode)
+	})
+
+	t.Run("limits concurrency", func(t *testing.T) {
+		group := NewTaskGroup(1, newTask(t, "sleep 0.2"), newTask(t, "sleep 0.2"))
+
+		started := time.Now()
+		assert.Nil(t, group.Run(context.Background()))
+		assert.GreaterOrEqual(t, int64(time.Since(started)), int64(400*time.Millisecond))
+	})
+
+	t.Run("cancel stops all tasks", func(t *testing.T) {
+		group := NewTaskGroup(1, newTask(t, "exec sleep 30"), newTask(t, "exec sleep 30"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		err := group.Run(ctx)
+		groupErr := &GroupError{}
+		assert.True(t, errors.As(err, &groupErr))
+		assert.Equal(t, context.DeadlineExceeded, groupErr.Errors[0])
+		assert.Equal(t, context.DeadlineExceeded, groupErr.Errors[1])
+	})
+}
+
+func TestTaskGroupState(t *testing.T) {
+	first := NewTask("a", "b", RsyncOptions{})
+	*first.state = State{Remain: 1, Total: 10, Speed: "1.00MB/s", SpeedBytesPerSec: 1024 * 1024, Progress: 90, Bytes: 100, TransferredFiles: 9, ETA: time.Second, OverallETA: time.Hour}
+	second := NewTask("a", "b", RsyncOptions{})
+	*second.state = State{Remain: 10, Total: 10, Speed: "512.00kB/s", SpeedBytesPerSec: 512 * 1024, Progress: 0, Bytes: 50, TransferredFiles: 0, ETA: time.Minute, OverallETA: 2 * time.Minute}
+
+	state := NewTaskGroup(0, first, second).State()
+	assert.Equal(t, 11, state.Remain)
+	assert.Equal(t, 20, state.Total)
+	assert.Equal(t, int64(150), state.Bytes)
+	assert.Equal(t, 9, state.TransferredFiles)
+	assert.Equal(t, float64(45), state.Progress)
+	assert.Equal(t, "1.50MB/s", state.Speed)
+	assert.Equal(t, float64(1.5*1024*1024), state.SpeedBytesPerSec)
+	assert.Equal(t, time.Minute, state.ETA)
+	assert.Equal(t, time.Hour, state.OverallETA)
+	assert.Equal(t, []State{*first.state, *second.state}, state.Tasks)
+}
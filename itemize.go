@@ -0,0 +1,196 @@
+package grsync
+
+import (
+	"strings"
+)
+
+// ItemType is the kind of filesystem entry an ItemChange refers to
+type ItemType int
+
+const (
+	// ItemFile is a regular file
+	ItemFile ItemType = iota
+	// ItemDir is a directory
+	ItemDir
+	// ItemSymlink is a symbolic link
+	ItemSymlink
+	// ItemDevice is a block or character device
+	ItemDevice
+	// ItemSpecial is a special file like a named socket or fifo
+	ItemSpecial
+)
+
+// String returns name of the item type
+func (i ItemType) String() string {
+	switch i {
+	case ItemFile:
+		return "file"
+	case ItemDir:
+		return "dir"
+	case ItemSymlink:
+		return "symlink"
+	case ItemDevice:
+		return "device"
+	case ItemSpecial:
+		return "special"
+	default:
+		return "unknown"
+	}
+}
+
+// ItemUpdate is the kind of update rsync performs on an item, the Y column of
+// the YXcstpoguax code
+type ItemUpdate byte
+
+const (
+	// UpdateSent the item is transferred to the remote host
+	UpdateSent ItemUpdate = '<'
+	// UpdateReceived the item is transferred to the local host
+	UpdateReceived ItemUpdate = '>'
+	// UpdateLocal the item is created or changed locally, e.g. a directory or symlink
+	UpdateLocal ItemUpdate = 'c'
+	// UpdateHardLink the item is a hard link to another item
+	UpdateHardLink ItemUpdate = 'h'
+	// UpdateAttributes the item is not transferred, only its attributes may change
+	UpdateAttributes ItemUpdate = '.'
+	// UpdateDeleted the item is removed
+	UpdateDeleted ItemUpdate = '*'
+)
+
+// ItemFlags tells which attributes of an item changed
+type ItemFlags struct {
+	// Checksum the file content differs, or a symlink/device has a new value
+	Checksum bool `json:"checksum"`
+	Size     bool `json:"size"`
+	Time     bool `json:"time"`
+	Perms    bool `json:"perms"`
+	Owner    bool `json:"owner"`
+	Group    bool `json:"group"`
+	// AccessTime is the access or creation time column (u, n or b)
+	AccessTime bool `json:"accessTime"`
+	ACL        bool `json:"acl"`
+	XAttr      bool `json:"xattr"`
+}
+
+// ItemChange is a single entry of rsync's --itemize-changes output
+type ItemChange struct {
+	// Path of the changed item, relative to the transfer root
+	Path string `json:"path"`
+	// Type of the item. Deletions don't report it, so directories are
+	// recognized by the trailing slash and everything else is ItemFile
+	Type   ItemType   `json:"type"`
+	Update ItemUpdate `json:"update"`
+	// Created is true for items which didn't exist on the receiver
+	Created bool `json:"created"`
+	// Deleted is true when rsync removes the item instead of creating or updating it
+	Deleted bool `json:"deleted"`
+	// Flags are the changed attributes of updated items
+	Flags ItemFlags `json:"flags"`
+	// Code is the raw itemize code, e.g. ">f.st......"
+	Code string `json:"code"`
+}
+
+// ItemChanges returns the changes rsync reported with RsyncOptions.ItemizeChanges.
+// Combined with RsyncOptions.DryRun it lists what a real run would do
+func (t *Task) ItemChanges() []ItemChange {
+	return parseItemChanges(t.Log().Stdout)
+}
+
+func parseItemChanges(output string) []ItemChange {
+	// Extract data from strings:
+	//     >f+++++++++ dir/file.txt
+	//     *deleting   dir/old.txt
+	itemMatcher := newMatcher(`^([<>ch.][fdLDS][.+ ?cstTpoguanbx]{7,9}) (.+)$`)
+	deletingMatcher := newMatcher(`^\*deleting +(.+)$`)
+
+	changes := []ItemChange{}
+	for _, line := range strings.FieldsFunc(output, isLineBreak) {
+		if deletingMatcher.Match(line) {
+			path := deletingMatcher.Extract(line)
+			itemType := ItemFile
+			if strings.HasSuffix(path, "/") {
+				itemType = ItemDir
+			}
+
+			changes = append(changes, ItemChange{
+				Path:    path,
+				Type:    itemType,
+				Update:  UpdateDeleted,
+				Deleted: true,
+				Code:    "*deleting",
+			})
+			continue
+		}
+
+		match := itemMatcher.regExp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		change := decodeItemCode(match[1])
+		change.Path = match[2]
+		if change.Type == ItemSymlink {
+			// Symlinks are printed as "link -> target"
+			if i := strings.Index(change.Path, " -> "); i >= 0 {
+				change.Path = change.Path[:i]
+			}
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+// decodeItemCode decodes the YXcstpoguax code. Older rsync versions print
+// fewer attribute columns, the missing ones are reported as unchanged
+func decodeItemCode(code string) ItemChange {
+	change := ItemChange{
+		Update: ItemUpdate(code[0]),
+		Code:   code,
+	}
+
+	switch code[1] {
+	case 'd':
+		change.Type = ItemDir
+	case 'L':
+		change.Type = ItemSymlink
+	case 'D':
+		change.Type = ItemDevice
+	case 'S':
+		change.Type = ItemSpecial
+	default:
+		change.Type = ItemFile
+	}
+
+	attributes := code[2:]
+	if strings.Trim(attributes, "+") == "" {
+		change.Created = true
+		return change
+	}
+
+	flags := []*bool{
+		&change.Flags.Checksum,
+		&change.Flags.Size,
+		&change.Flags.Time,
+		&change.Flags.Perms,
+		&change.Flags.Owner,
+		&change.Flags.Group,
+		&change.Flags.AccessTime,
+		&change.Flags.ACL,
+		&change.Flags.XAttr,
+	}
+	for i := 0; i < len(attributes) && i < len(flags); i++ {
+		switch attributes[i] {
+		case '.', ' ', '+', '?':
+		default:
+			*flags[i] = true
+		}
+	}
+
+	return change
+}
+
+func isLineBreak(r rune) bool {
+	return r == '\n' || r == '\r'
+}
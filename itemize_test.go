@@ -0,0 +1,72 @@
+package grsync
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseItemChanges(t *testing.T) {
+	t.Run("additions, updates and deletions", func(t *testing.T) {
+		const output = "sending incremental file list\n" +
+			"*deleting   stale.txt\n" +
+			"*deleting   old dir/\n" +
+			".d..t...... ./\n" +
+			">f+++++++++ new.txt\n" +
+			">f.st...... docs/changed.md\n" +
+			"cd+++++++++ empty dir/\n" +
+			"cL+++++++++ latest -> releases/1.0\n" +
+			"\n" +
+			"sent 123 bytes  received 45 bytes  336.00 bytes/sec\n" +
+			"total size is 1,024  speedup is 6.10 (DRY RUN)\n"
+
+		assert.Equal(t, []ItemChange{
+			{Path: "stale.txt", Type: ItemFile, Update: UpdateDeleted, Deleted: true, Code: "*deleting"},
+			{Path: "old dir/", Type: ItemDir, Update: UpdateDeleted, Deleted: true, Code: "*deleting"},
+			{Path: "./", Type: ItemDir, Update: UpdateAttributes, Flags: ItemFlags{Time: true}, Code: ".d..t......"},
+			{Path: "new.txt", Type: ItemFile, Update: UpdateReceived, Created: true, Code: ">f+++++++++"},
+			{Path: "docs/changed.md", Type: ItemFile, Update: UpdateReceived, Flags: ItemFlags{Size: true, Time: true}, Code: ">f.st......"},
+			{Path: "empty dir/", Type: ItemDir, Update: UpdateLocal, Created: true, Code: "cd+++++++++"},
+			{Path: "latest", Type: ItemSymlink, Update: UpdateLocal, Created: true, Code: "cL+++++++++"},
+		}, parseItemChanges(output))
+	})
+
+	t.Run("nothing to do", func(t *testing.T) {
+		assert.Empty(t, parseItemChanges("sending incremental file list\n\nsent 51 bytes  received 12 bytes\n"))
+	})
+}
+
+func TestDecodeItemCode(t *testing.T) {
+	t.Run("all attributes", func(t *testing.T) {
+		change := decodeItemCode("<fcstpoguax")
+		assert.Equal(t, UpdateSent, change.Update)
+		assert.False(t, change.Created)
+		assert.Equal(t, ItemFlags{
+			Checksum:   true,
+			Size:       true,
+			Time:       true,
+			Perms:      true,
+			Owner:      true,
+			Group:      true,
+			AccessTime: true,
+			ACL:        true,
+			XAttr:      true,
+		}, change.Flags)
+	})
+
+	t.Run("transfer time and hard link", func(t *testing.T) {
+		change := decodeItemCode("hf..T......")
+		assert.Equal(t, UpdateHardLink, change.Update)
+		assert.Equal(t, ItemFlags{Time: true}, change.Flags)
+	})
+
+	t.Run("devices and specials", func(t *testing.T) {
+		assert.Equal(t, ItemDevice, decodeItemCode("cD+++++++++").Type)
+		assert.Equal(t, ItemSpecial, decodeItemCode("cS+++++++++").Type)
+	})
+
+	t.Run("short code of older rsync", func(t *testing.T) {
+		change := decodeItemCode(">f..tp....")
+		assert.Equal(t, ItemFlags{Time: true, Perms: true}, change.Flags)
+	})
+}
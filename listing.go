@@ -0,0 +1,77 @@
+package grsync
+
+import (
+	"strings"
+	"time"
+)
+
+// listTimeLayout is the modification time format of rsync's file listing
+const listTimeLayout = "2006/01/02 15:04:05"
+
+// FileInfo is a single entry of rsync's --list-only output
+type FileInfo struct {
+	// Perms is the mode string, e.g. "drwxr-xr-x"
+	Perms string `json:"perms"`
+	// Size in bytes. Tasks created with NewTask force --human-readable, so the
+	// size is rounded to the precision rsync prints, e.g. 16.78M
+	Size int64 `json:"size"`
+	// ModTime is the modification time in the local time zone, as printed by rsync
+	ModTime time.Time `json:"modTime"`
+	// Path of the entry relative to the listed source; for symlinks the target
+	// is not included
+	Path string `json:"path"`
+}
+
+// IsDir reports whether the entry is a directory
+func (f FileInfo) IsDir() bool {
+	return strings.HasPrefix(f.Perms, "d")
+}
+
+// FileList returns the entries rsync printed with RsyncOptions.ListOnly. Lines
+// which are not part of the listing are skipped
+func (t *Task) FileList() []FileInfo {
+	return parseFileList(t.Log().Stdout)
+}
+
+func parseFileList(output string) []FileInfo {
+	// Extract data from strings:
+	//     drwxr-xr-x          4,096 2023/01/02 15:04:05 dir
+	//     -rw-r--r--         16.78M 2023/01/02 15:04:05 dir/file.txt
+	//     lrwxrwxrwx             11 2023/01/02 15:04:05 latest -> releases/1.0
+	entryMatcher := newMatcher(`^([-dlcbps][-rwxsStT]{9})\s+([\d,.]+[KMGTP]?)\s+(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) (.+)$`)
+
+	entries := []FileInfo{}
+	for _, line := range strings.FieldsFunc(output, isLineBreak) {
+		match := entryMatcher.regExp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		size, err := parseSize(match[2])
+		if err != nil {
+			continue
+		}
+
+		modTime, err := time.ParseInLocation(listTimeLayout, match[3], time.Local)
+		if err != nil {
+			continue
+		}
+
+		path := match[4]
+		if match[1][0] == 'l' {
+			// Symlinks are printed as "link -> target"
+			if i := strings.Index(path, " -> "); i >= 0 {
+				path = path[:i]
+			}
+		}
+
+		entries = append(entries, FileInfo{
+			Perms:   match[1],
+			Size:    size,
+			ModTime: modTime,
+			Path:    path,
+		})
+	}
+
+	return entries
+}
@@ -0,0 +1,35 @@
+package grsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFileList(t *testing.T) {
+	t.Run("files, directories and symlinks", func(t *testing.T) {
+		const output = "receiving incremental file list\n" +
+			"drwxr-xr-x          4,096 2023/01/02 15:04:05 .\n" +
+			"-rw-r--r--         16.78M 2023/01/02 15:04:06 data.bin\n" +
+			"-rw-r--r--             12 2022/12/31 23:59:59 dir with spaces/notes.txt\n" +
+			"lrwxrwxrwx             11 2023/01/02 15:04:05 latest -> releases/1.0\n" +
+			"\n" +
+			"sent 20 bytes  received 120 bytes  280.00 bytes/sec\n" +
+			"total size is 16,781,324  speedup is 119,866.60\n"
+
+		entries := parseFileList(output)
+		assert.Equal(t, []FileInfo{
+			{Perms: "drwxr-xr-x", Size: 4096, ModTime: time.Date(2023, 1, 2, 15, 4, 5, 0, time.Local), Path: "."},
+			{Perms: "-rw-r--r--", Size: 16780000, ModTime: time.Date(2023, 1, 2, 15, 4, 6, 0, time.Local), Path: "data.bin"},
+			{Perms: "-rw-r--r--", Size: 12, ModTime: time.Date(2022, 12, 31, 23, 59, 59, 0, time.Local), Path: "dir with spaces/notes.txt"},
+			{Perms: "lrwxrwxrwx", Size: 11, ModTime: time.Date(2023, 1, 2, 15, 4, 5, 0, time.Local), Path: "latest"},
+		}, entries)
+		assert.True(t, entries[0].IsDir())
+		assert.False(t, entries[1].IsDir())
+	})
+
+	t.Run("nothing listed", func(t *testing.T) {
+		assert.Empty(t, parseFileList("receiving incremental file list\n\nsent 20 bytes  received 12 bytes\n"))
+	})
+}
@@ -0,0 +1,55 @@
+package grsync
+
+import (
+	"strings"
+)
+
+// Messages contains stderr lines of the last run split by severity
+type Messages struct {
+	Warnings []string `json:"warnings"`
+	Errors   []string `json:"errors"`
+}
+
+// Messages classifies what rsync printed on stderr. Lines with rsync's known
+// prefixes are classified by them; other lines, e.g. from ssh, are warnings
+// when rsync succeeded or only reported vanished files, errors otherwise
+func (t *Task) Messages() Messages {
+	t.mutex.Lock()
+	stderr := t.stderr.String(t.maxLogBytes)
+	exitCode := t.exitCode
+	t.mutex.Unlock()
+
+	return parseMessages(stderr, exitCode)
+}
+
+func parseMessages(stderr string, exitCode int) Messages {
+	const vanishedExitCode = 24
+
+	// Extract data from strings:
+	//     rsync warning: some files vanished before they could be transferred (code 24) at main.c(1865)
+	//     file has vanished: "/src/tmp/cache"
+	//     rsync: [sender] send_files failed to open "/src/secret": Permission denied (13)
+	//     rsync error: some files/attrs were not transferred (see previous errors) (code 23) at main.c(1338)
+	warningMatcher := newMatcher(`^(rsync warning: |(rsync: )?file has vanished: |WARNING: )`)
+	errorMatcher := newMatcher(`^(rsync( error)?: |ERROR: |@ERROR)`)
+	benign := exitCode == 0 || exitCode == vanishedExitCode
+
+	messages := Messages{
+		Warnings: []string{},
+		Errors:   []string{},
+	}
+	for _, line := range strings.FieldsFunc(stderr, isLineBreak) {
+		switch {
+		case warningMatcher.Match(line):
+			messages.Warnings = append(messages.Warnings, line)
+		case errorMatcher.Match(line):
+			messages.Errors = append(messages.Errors, line)
+		case benign:
+			messages.Warnings = append(messages.Warnings, line)
+		default:
+			messages.Errors = append(messages.Errors, line)
+		}
+	}
+
+	return messages
+}
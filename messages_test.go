@@ -0,0 +1,60 @@
+package grsync
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMessages(t *testing.T) {
+	t.Run("vanished files", func(t *testing.T) {
+		const stderr = "file has vanished: \"/src/tmp/cache\"\n" +
+			"Warning: Permanently added 'host' (ED25519) to the list of known hosts.\n" +
+			"rsync warning: some files vanished before they could be transferred (code 24) at main.c(1865) [sender=3.2.7]\n"
+
+		assert.Equal(t, Messages{
+			Warnings: []string{
+				`file has vanished: "/src/tmp/cache"`,
+				"Warning: Permanently added 'host' (ED25519) to the list of known hosts.",
+				"rsync warning: some files vanished before they could be transferred (code 24) at main.c(1865) [sender=3.2.7]",
+			},
+			Errors: []string{},
+		}, parseMessages(stderr, 24))
+	})
+
+	t.Run("partial transfer", func(t *testing.T) {
+		const stderr = "rsync: [sender] send_files failed to open \"/src/secret\": Permission denied (13)\n" +
+			"rsync: file has vanished: \"/src/tmp\"\n" +
+			"rsync error: some files/attrs were not transferred (see previous errors) (code 23) at main.c(1338) [sender=3.2.7]\n"
+
+		assert.Equal(t, Messages{
+			Warnings: []string{`rsync: file has vanished: "/src/tmp"`},
+			Errors: []string{
+				`rsync: [sender] send_files failed to open "/src/secret": Permission denied (13)`,
+				"rsync error: some files/attrs were not transferred (see previous errors) (code 23) at main.c(1338) [sender=3.2.7]",
+			},
+		}, parseMessages(stderr, 23))
+	})
+
+	t.Run("remote shell failure", func(t *testing.T) {
+		const stderr = "ssh: connect to host example.org port 22: Connection refused\n" +
+			"rsync: connection unexpectedly closed (0 bytes received so far) [Receiver]\n"
+
+		messages := parseMessages(stderr, 255)
+		assert.Empty(t, messages.Warnings)
+		assert.Len(t, messages.Errors, 2)
+	})
+}
+
+func TestTaskMessages(t *testing.T) {
+	createdTask := NewTask("a", filepath.Join(t.TempDir(), "destDir"), RsyncOptions{
+		RsyncBinaryPath: fakeRsync(t, "echo 'some remote notice' >&2\necho 'rsync error: error in file IO (code 11)' >&2\nexit 11"),
+	})
+
+	assert.NotNil(t, createdTask.Run())
+	assert.Equal(t, Messages{
+		Warnings: []string{},
+		Errors:   []string{"some remote notice", "rsync error: error in file IO (code 11)"},
+	}, createdTask.Messages())
+}
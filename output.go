@@ -0,0 +1,56 @@
+package grsync
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// combinedTimeLayout is the timestamp format of the combined output
+const combinedTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+// combinedWriter writes lines of both rsync streams to one writer, whole
+// lines at a time, each prefixed with a timestamp and the stream name
+type combinedWriter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	// start anchors the timestamps, which are derived from the monotonic
+	// clock so they never go backwards even if the wall clock does
+	start time.Time
+}
+
+func newCombinedWriter(writer io.Writer) *combinedWriter {
+	return &combinedWriter{
+		writer: writer,
+		start:  time.Now(),
+	}
+}
+
+// writeLine writes data without its line break as a single line
+func (c *combinedWriter) writeLine(stream, data string) {
+	line := strings.TrimRight(data, "\r\n")
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	timestamp := c.start.Add(time.Since(c.start)).Format(combinedTimeLayout)
+	fmt.Fprintf(c.writer, "%s [%s] %s\n", timestamp, stream, line)
+}
+
+// SetCombinedOutput makes the task write stdout and stderr lines of rsync to w
+// in the order they arrive, each line prefixed with a timestamp and the stream,
+// e.g. "2024-01-02T15:04:05.000000+01:00 [stderr] rsync: ...". Progress redraws
+// are written as separate lines. nil disables the output
+func (t *Task) SetCombinedOutput(w io.Writer) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if w == nil {
+		t.combined = nil
+		return
+	}
+
+	t.combined = newCombinedWriter(w)
+}
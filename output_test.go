@@ -0,0 +1,74 @@
+package grsync
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskCombinedOutput(t *testing.T) {
+	createdTask := NewTask("a", filepath.Join(t.TempDir(), "destDir"), RsyncOptions{
+		RsyncBinaryPath: fakeRsync(t, "echo a.txt\nsleep 0.1\necho 'rsync: send_files failed' >&2\nsleep 0.1\n"+
+			"printf '          1,024 100%%    1.00MB/s    0:00:00 (xfr#1, to-chk=0/1)\\n'"),
+	})
+	var output bytes.Buffer
+	createdTask.SetCombinedOutput(&output)
+
+	assert.Nil(t, createdTask.Run())
+
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if !assert.Len(t, lines, 3) {
+		return
+	}
+
+	linePattern := regexp.MustCompile(`^(\S+) \[(stdout|stderr)\] (.*)$`)
+	expected := [][]string{
+		{"stdout", "a.txt"},
+		{"stderr", "rsync: send_files failed"},
+		{"stdout", "          1,024 100%    1.00MB/s    0:00:00 (xfr#1, to-chk=0/1)"},
+	}
+	previous := time.Time{}
+	for i, line := range lines {
+		match := linePattern.FindStringSubmatch(line)
+		if !assert.NotNil(t, match, line) {
+			continue
+		}
+
+		timestamp, err := time.Parse(combinedTimeLayout, match[1])
+		assert.Nil(t, err)
+		assert.False(t, timestamp.Before(previous), "timestamps should not go backwards")
+		previous = timestamp
+
+		assert.Equal(t, expected[i], match[2:])
+	}
+}
+
+func TestCombinedWriterWholeLines(t *testing.T) {
+	var output bytes.Buffer
+	combined := newCombinedWriter(&output)
+
+	var wg sync.WaitGroup
+	for _, stream := range []string{"stdout", "stderr"} {
+		wg.Add(1)
+		go func(stream string) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				combined.writeLine(stream, strings.Repeat("x", 100)+"\n")
+			}
+		}(stream)
+	}
+	wg.Wait()
+
+	linePattern := regexp.MustCompile(`^\S+ \[(stdout|stderr)\] x{100}$`)
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	assert.Len(t, lines, 200)
+	for _, line := range lines {
+		assert.Regexp(t, linePattern, line)
+	}
+}
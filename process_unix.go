@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package grsync
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes rsync the leader of a new process group, so pausing
+// it also stops the remote shell it runs
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// pauseProcess stops the process group of pid
+func pauseProcess(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGSTOP)
+}
+
+// resumeProcess continues the process group of pid
+func resumeProcess(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGCONT)
+}
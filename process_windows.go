@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package grsync
+
+import "os/exec"
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func pauseProcess(pid int) error {
+	return ErrPauseUnsupported
+}
+
+func resumeProcess(pid int) error {
+	return ErrPauseUnsupported
+}
@@ -0,0 +1,162 @@
+package grsync
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Stats contains the file-transfer summary printed by rsync with --stats
+type Stats struct {
+	Files                    int     `json:"files"`
+	RegularFilesTransferred  int     `json:"regularFilesTransferred"`
+	TotalFileSize            int64   `json:"totalFileSize"`
+	TotalTransferredFileSize int64   `json:"totalTransferredFileSize"`
+	LiteralData              int64   `json:"literalData"`
+	MatchedData              int64   `json:"matchedData"`
+	Speedup                  float64 `json:"speedup"`
+	// BytesSent, BytesReceived, BytesPerSec and TotalSize come from the closing
+	// summary, which rsync prints even without --stats unless Quiet is set
+	BytesSent     int64   `json:"bytesSent"`
+	BytesReceived int64   `json:"bytesReceived"`
+	BytesPerSec   float64 `json:"bytesPerSec"`
+	TotalSize     int64   `json:"totalSize"`
+}
+
+// Stats returns the summary parsed from the rsync output. It is meant to be
+// called after Run has completed with RsyncOptions.Stats enabled; without
+// --stats only the closing "sent ... received" and "total size is" lines are
+// available, so only their fields are filled
+func (t *Task) Stats() (Stats, error) {
+	return parseStats(t.Log().Stdout)
+}
+
+func parseStats(output string) (Stats, error) {
+	const number = `([\d,.]+[KMGTP]?)`
+
+	stats := Stats{}
+	counters := []struct {
+		matcher *matcher
+		value   *int
+	}{
+		{newMatcher(`Number of files: ` + number), &stats.Files},
+		{newMatcher(`Number of (?:regular )?files transferred: ` + number), &stats.RegularFilesTransferred},
+	}
+	sizes := []struct {
+		matcher *matcher
+		value   *int64
+	}{
+		{newMatcher(`Total file size: ` + number), &stats.TotalFileSize},
+		{newMatcher(`Total transferred file size: ` + number), &stats.TotalTransferredFileSize},
+		{newMatcher(`Literal data: ` + number), &stats.LiteralData},
+		{newMatcher(`Matched data: ` + number), &stats.MatchedData},
+		// Summary lines:
+		//     sent 35,890 bytes  received 35 bytes  71,850.00 bytes/sec
+		//     total size is 1,234,567  speedup is 34.36
+		{newMatcher(`^sent ` + number + ` bytes`), &stats.BytesSent},
+		{newMatcher(`^sent .* received ` + number + ` bytes`), &stats.BytesReceived},
+		{newMatcher(`^total size is ` + number), &stats.TotalSize},
+	}
+	bytesPerSecMatcher := newMatcher(`^sent .* ` + number + ` bytes/sec`)
+	speedupMatcher := newMatcher(`speedup is ([\d,.]+)`)
+
+	for _, line := range strings.Split(output, "\n") {
+		for _, counter := range counters {
+			if counter.matcher.Match(line) {
+				value, err := parseSize(counter.matcher.Extract(line))
+				if err != nil {
+					return Stats{}, err
+				}
+				*counter.value = int(value)
+			}
+		}
+
+		for _, size := range sizes {
+			if size.matcher.Match(line) {
+				value, err := parseSize(size.matcher.Extract(line))
+				if err != nil {
+					return Stats{}, err
+				}
+				*size.value = value
+			}
+		}
+
+		if bytesPerSecMatcher.Match(line) {
+			rate, err := parseSizeFloat(bytesPerSecMatcher.Extract(line))
+			if err != nil {
+				return Stats{}, err
+			}
+			stats.BytesPerSec = rate
+		}
+
+		if speedupMatcher.Match(line) {
+			value := strings.Replace(speedupMatcher.Extract(line), ",", "", -1)
+			speedup, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Stats{}, fmt.Errorf("invalid speedup %q: %w", value, err)
+			}
+			stats.Speedup = speedup
+		}
+	}
+
+	return stats, nil
+}
+
+// parseSize converts a number printed by rsync into an integer. Both digit
+// grouping (1,234,567, or 1.234.567 from a localized rsync) and
+// --human-readable suffixes (16.78M) are understood; suffixes are powers of
+// 1000, matching rsync's -h output
+func parseSize(value string) (int64, error) {
+	number, err := parseSizeFloat(value)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(math.Round(number)), nil
+}
+
+// normalizeNumber drops the digit grouping of value and makes '.' its decimal
+// separator. The last separator is the decimal one when both are used; a
+// single one is grouping when it is repeated or followed by exactly 3 digits,
+// as rsync prints 2 decimals
+func normalizeNumber(value string) string {
+	last := strings.LastIndexAny(value, ",.")
+	if last < 0 {
+		return value
+	}
+
+	separator := value[last]
+	other := byte(',')
+	if separator == ',' {
+		other = '.'
+	}
+
+	grouping := strings.IndexByte(value, other) < 0 &&
+		(strings.Count(value, string(separator)) > 1 || len(value)-last-1 == 3)
+	if grouping {
+		return strings.Replace(value, string(separator), "", -1)
+	}
+
+	integer := strings.NewReplacer(",", "", ".", "").Replace(value[:last])
+	return integer + "." + value[last+1:]
+}
+
+// parseSizeFloat is parseSize keeping the fraction, e.g. of a bytes/sec rate
+func parseSizeFloat(value string) (float64, error) {
+	const suffixes = "KMGTP"
+
+	multiplier := float64(1)
+	if i := strings.IndexAny(value, suffixes); i >= 0 && i == len(value)-1 {
+		multiplier = math.Pow(1000, float64(strings.IndexByte(suffixes, value[i])+1))
+		value = value[:i]
+	}
+
+	value = normalizeNumber(value)
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q: %w", value, err)
+	}
+
+	return number * multiplier, nil
+}
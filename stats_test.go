@@ -0,0 +1,109 @@
+package grsync
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStats(t *testing.T) {
+	t.Run("comma grouped numbers", func(t *testing.T) {
+		const output = `
+Number of files: 1,235 (reg: 1,200, dir: 35)
+Number of created files: 1 (reg: 1)
+Number of deleted files: 0
+Number of regular files transferred: 1,200
+Total file size: 1,234,567 bytes
+Total transferred file size: 234,567 bytes
+Literal data: 34,567 bytes
+Matched data: 200,000 bytes
+File list size: 0
+File list generation time: 0.001 seconds
+File list transfer time: 0.000 seconds
+Total bytes sent: 35,890
+Total bytes received: 35
+
+sent 35,890 bytes  received 35 bytes  71,850.00 bytes/sec
+total size is 1,234,567  speedup is 34.36
+`
+		stats, err := parseStats(output)
+		assert.Nil(t, err)
+		assert.Equal(t, Stats{
+			Files:                    1235,
+			RegularFilesTransferred:  1200,
+			TotalFileSize:            1234567,
+			TotalTransferredFileSize: 234567,
+			LiteralData:              34567,
+			MatchedData:              200000,
+			Speedup:                  34.36,
+			BytesSent:                35890,
+			BytesReceived:            35,
+			BytesPerSec:              71850,
+			TotalSize:                1234567,
+		}, stats)
+	})
+
+	t.Run("human readable numbers", func(t *testing.T) {
+		const output = `
+Number of files: 1 (reg: 1)
+Number of regular files transferred: 1
+Total file size: 16.78M bytes
+Total transferred file size: 16.78M bytes
+Literal data: 16.78M bytes
+Matched data: 0 bytes
+total size is 16.78M  speedup is 1.00
+`
+		stats, err := parseStats(output)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(16780000), stats.TotalFileSize)
+		assert.Equal(t, int64(0), stats.MatchedData)
+		assert.Equal(t, 1.0, stats.Speedup)
+	})
+
+	t.Run("summary only", func(t *testing.T) {
+		const output = "sending incremental file list\n" +
+			"a\n" +
+			"\n" +
+			"sent 16.78M bytes  received 35 bytes  11.19M bytes/sec\n" +
+			"total size is 16.78M  speedup is 1.00\n"
+
+		stats, err := parseStats(output)
+		assert.Nil(t, err)
+		assert.Equal(t, Stats{
+			Speedup:       1,
+			BytesSent:     16780000,
+			BytesReceived: 35,
+			BytesPerSec:   11190000,
+			TotalSize:     16780000,
+		}, stats)
+	})
+
+	t.Run("without --stats", func(t *testing.T) {
+		stats, err := parseStats("sending incremental file list\na\n")
+		assert.Nil(t, err)
+		assert.Empty(t, stats)
+	})
+}
+
+func TestParseSize(t *testing.T) {
+	for input, expected := range map[string]int64{
+		"0":         0,
+		"999":       999,
+		"1,234,567": 1234567,
+		"1.234.567": 1234567,
+		"1.234":     1234,
+		"71.850,00": 71850,
+		"71,850.00": 71850,
+		"12.50":     13,
+		"32.77K":    32770,
+		"16.78M":    16780000,
+		"1.50G":     1500000000,
+	} {
+		size, err := parseSize(input)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, size, input)
+	}
+
+	_, err := parseSize("abc")
+	assert.NotNil(t, err)
+}
@@ -2,20 +2,88 @@ package grsync
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 )
 
+// maxLineLength is the longest line of rsync output the parsers accept
+const maxLineLength = 1024 * 1024
+
+// progressBufferSize is how many State snapshots Task.Progress buffers
+const progressBufferSize = 8
+
+// progressMatcher extracts the "remain/total" files of the progress line tail,
+// "to-chk=" and "ir-chk=" since rsync 3.1 and "to-check=" before. The tail is
+// only printed once a file is done
+var progressMatcher = newMatcher(`\((?:xfe?r#\d+, )?(?:to|ir)-ch(?:ec)?k=(\d+/\d+)\)`)
+
+// fileDoneMatcher extracts the count of the files transferred, "xfr#" since
+// rsync 3.1 and "xfer#" before
+var fileDoneMatcher = newMatcher(`\(xfe?r#(\d+)`)
+
+// shellSafeMatcher matches arguments which need no quoting in a shell
+var shellSafeMatcher = newMatcher(`^[\w@%+=:,./-]+$`)
+
+// defaultSpeedWindow is how many speed samples State keeps by default
+const defaultSpeedWindow = 10
+
+// stopGracePeriod is how long rsync is given to exit after SIGTERM before it is killed
+const stopGracePeriod = 5 * time.Second
+
 // Task is high-level API under rsync
 type Task struct {
 	rsync *Rsync
+	// current is the copy of rsync the run in progress uses, so the setters
+	// can change rsync meanwhile. nil until rsync has started
+	current *Rsync
 
 	state *State
-	log   *Log
-	mutex sync.Mutex
+	// stdout and stderr hold the output for Log
+	stdout logBuffer
+	stderr logBuffer
+	mutex  sync.Mutex
+
+	running  bool
+	paused   bool
+	cancel   context.CancelFunc
+	pid      int
+	exitCode int
+	started  time.Time
+	finished time.Time
+	progress chan State
+	// retrying keeps the progress channel open between RunWithRetry attempts
+	retrying bool
+	onEvent  func(Event)
+
+	onFileComplete func(FileResult)
+
+	progressInterval time.Duration
+	lastProgress     time.Time
+	pendingProgress  bool
+	speedWindow      int
+	// completedBytes is the size of the files transferred so far by the
+	// current run, for estimating the overall ETA without --info=progress2
+	completedBytes int64
+	// filesBase is State.TransferredFiles when the current run started, as
+	// every run counts xfr# from 1
+	filesBase int
+
+	maxLogBytes  int
+	stdoutWriter io.Writer
+	stderrWriter io.Writer
+	onStderrLine func(string)
+	stripControl bool
+	combined     *combinedWriter
 }
 
 // State contains information about rsync process
@@ -24,6 +92,25 @@ type State struct {
 	Total    int     `json:"total"`
 	Speed    string  `json:"speed"`
 	Progress float64 `json:"progress"`
+	// SpeedBytesPerSec is Speed in bytes per second. rsync divides the rate by
+	// 1024 for every unit, so "1.00kB/s" is 1024 bytes per second
+	SpeedBytesPerSec float64 `json:"speedBytesPerSec"`
+	// SpeedSamples are the last speeds parsed, in bytes per second and oldest
+	// first, for computing a moving average. Task.SetSpeedWindow sets how many are kept
+	SpeedSamples []float64 `json:"speedSamples,omitempty"`
+	// Bytes transferred so far, for the file in flight or for the whole transfer with --info=progress2
+	Bytes int64 `json:"bytes"`
+	// TransferredFiles is the number of files transferred so far
+	TransferredFiles int `json:"transferredFiles"`
+	// CurrentFile is the name of the file being transferred, empty between files
+	CurrentFile string `json:"currentFile"`
+	// ETA is the time left for the file in flight, or for the whole transfer with --info=progress2
+	ETA time.Duration `json:"eta"`
+	// OverallETA is the estimated time left for the whole transfer at the mean
+	// of SpeedSamples. The remaining bytes come from Progress with
+	// --info=progress2, otherwise from Remain files at the mean size of those
+	// transferred so far. It is 0 until there is enough output to estimate it
+	OverallETA time.Duration `json:"overallEta"`
 }
 
 // Log contains raw stderr and stdout outputs
@@ -45,32 +132,187 @@ func (t *Task) State() State {
 func (t *Task) Log() Log {
 	t.mutex.Lock()
 	l := Log{
-		Stderr: t.log.Stderr,
-		Stdout: t.log.Stdout,
+		Stderr: t.stderr.String(t.maxLogBytes),
+		Stdout: t.stdout.String(t.maxLogBytes),
 	}
 	t.mutex.Unlock()
 	return l
 }
 
+// SetMaxLogBytes limits how many of the most recent bytes of stdout and
+// stderr are kept in the Log. Older output is discarded and the Log starts at
+// the first line beginning within the limit. 0 means unlimited
+func (t *Task) SetMaxLogBytes(n int) {
+	t.mutex.Lock()
+	t.maxLogBytes = n
+	t.mutex.Unlock()
+}
+
+// SetStdoutWriter makes the task copy every line rsync prints on stdout to w
+// as it arrives. nil disables the copy
+func (t *Task) SetStdoutWriter(w io.Writer) {
+	t.mutex.Lock()
+	t.stdoutWriter = w
+	t.mutex.Unlock()
+}
+
+// SetStderrWriter makes the task copy every line rsync prints on stderr to w
+// as it arrives. nil disables the copy
+func (t *Task) SetStderrWriter(w io.Writer) {
+	t.mutex.Lock()
+	t.stderrWriter = w
+	t.mutex.Unlock()
+}
+
+// SetEnv sets variables added to the environment rsync inherits, e.g.
+// RSYNC_PASSWORD or RSYNC_RSH, which keeps secrets out of the command line.
+// Entries override inherited variables of the same name; nil, the default,
+// passes the inherited environment unchanged. It applies from the next run
+func (t *Task) SetEnv(env map[string]string) {
+	t.mutex.Lock()
+	t.rsync.env = map[string]string{}
+	for key, value := range env {
+		t.rsync.env[key] = value
+	}
+	t.mutex.Unlock()
+}
+
+// SetDir sets the working directory of rsync, which relative sources, the
+// destination and option paths like FilesFrom are resolved against. The
+// directory must exist when the task runs; empty, the default, keeps the
+// current directory
+func (t *Task) SetDir(dir string) {
+	t.mutex.Lock()
+	t.rsync.dir = dir
+	t.mutex.Unlock()
+}
+
+// SetStripControlChars makes the task remove ANSI escape sequences and other
+// control characters from Log and the output writers, and keep only the last
+// redraw of lines rsync overwrites with a carriage return. The State is parsed
+// from the raw output either way
+func (t *Task) SetStripControlChars(strip bool) {
+	t.mutex.Lock()
+	t.stripControl = strip
+	t.mutex.Unlock()
+}
+
+// OnStderrLine sets a callback receiving every line rsync prints on stderr,
+// without the trailing newline, as it arrives; nil removes it. The callback
+// runs without holding the task lock, so it may call State or Log
+func (t *Task) OnStderrLine(handler func(string)) {
+	t.mutex.Lock()
+	t.onStderrLine = handler
+	t.mutex.Unlock()
+}
+
+// logBuffer holds the output of a stream. With a limit it keeps at least the
+// last limit bytes and compacts only once it holds twice as many, so every
+// byte is copied a bounded number of times
+type logBuffer struct {
+	data []byte
+}
+
+// append adds data to the buffer, limit is the Task.SetMaxLogBytes value
+func (b *logBuffer) append(data string, limit int) {
+	b.data = append(b.data, data...)
+	// One byte more than the limit tells String whether a line starts at the cut
+	if limit > 0 && len(b.data) >= 2*limit+1 {
+		kept := copy(b.data, b.data[len(b.data)-limit-1:])
+		b.data = b.data[:kept]
+	}
+}
+
+// String returns at most the last limit bytes, starting at a line when one
+// begins within them, or else at a character
+func (b *logBuffer) String(limit int) string {
+	start := 0
+	if limit > 0 && len(b.data) > limit {
+		start = len(b.data) - limit
+		if b.data[start-1] != '\n' {
+			if i := bytes.IndexByte(b.data[start:len(b.data)-1], '\n'); i >= 0 {
+				start += i + 1
+			} else {
+				for start < len(b.data) && !utf8.RuneStart(b.data[start]) {
+					start++
+				}
+			}
+		}
+	}
+
+	return string(b.data[start:])
+}
+
 // Run starts rsync process with options
 func (t *Task) Run() error {
-	stderr, err := t.rsync.StderrPipe()
+	return t.RunContext(context.Background())
+}
+
+// RunContext starts rsync process with options. When ctx is done before rsync
+// exits, the process receives SIGTERM, then SIGKILL after a grace period,
+// and ctx.Err() is returned. The output is parsed to the end before RunContext
+// returns, so State then holds the last values rsync printed, also after a
+// cancel. A non-zero exit of rsync is reported as *RsyncError.
+// ErrAlreadyRunning is returned when the task is running already
+func (t *Task) RunContext(ctx context.Context) error {
+	return t.runContext(ctx, false)
+}
+
+// runContext is RunContext; attempt is true for the runs of RunWithRetry,
+// which may start while the retry loop holds the task
+func (t *Task) runContext(ctx context.Context, attempt bool) error {
+	parent := ctx
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	t.mutex.Lock()
+	if t.running || (t.retrying && !attempt) {
+		t.mutex.Unlock()
+		return ErrAlreadyRunning
+	}
+	t.running = true
+	// Stop cancels the run, then again the retry loop once it's over
+	loopCancel := t.cancel
+	t.cancel = cancel
+	t.lastProgress = time.Time{}
+	t.filesBase = t.state.TransferredFiles
+	t.completedBytes = 0
+	run := *t.rsync
+	t.mutex.Unlock()
+	defer func() {
+		t.mutex.Lock()
+		t.running = false
+		t.cancel = loopCancel
+		t.current = nil
+		if !t.retrying {
+			t.closeProgress()
+		}
+		t.mutex.Unlock()
+	}()
+
+	if err := run.validate(); err != nil {
+		return err
+	}
+
+	run.cmd = run.newCommand()
+
+	stderr, err := run.StderrPipe()
 	if err != nil {
 		return err
 	}
 
-	stdout, err := t.rsync.StdoutPipe()
+	stdout, err := run.StdoutPipe()
 	if err != nil {
 		stderr.Close()
 		return err
 	}
 
 	var wg sync.WaitGroup
+	wg.Add(2)
 	go processStdout(&wg, t, stdout)
 	go processStderr(&wg, t, stderr)
-	wg.Add(2)
 
-	if err = t.rsync.Start(); err != nil {
+	if err = run.Start(); err != nil {
 		// Close pipes to unblock goroutines
 		stdout.Close()
 		stderr.Close()
@@ -78,23 +320,423 @@ func (t *Task) Run() error {
 		return err
 	}
 
+	t.mutex.Lock()
+	t.current = &run
+	t.rsync.cmd = run.cmd
+	t.pid = run.cmd.Process.Pid
+	t.started = time.Now()
+	t.finished = time.Time{}
+	t.mutex.Unlock()
+
+	t.emit(Event{Type: EventStarted, State: t.State()})
+
+	exited := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			run.stop(exited, stopGracePeriod)
+		case <-exited:
+		}
+	}()
+
 	wg.Wait()
 
-	return t.rsync.Wait()
+	err = run.Wait()
+	close(exited)
+	<-stopped
+
+	exitCode := 0
+	if ctxErr := parent.Err(); ctxErr != nil {
+		err = ctxErr
+		exitCode = -1
+	} else if err != nil {
+		err = newRsyncError(err, t.Log().Stderr)
+		exitCode = -1
+		var rsyncErr *RsyncError
+		if errors.As(err, &rsyncErr) {
+			exitCode = rsyncErr.ExitCode
+		}
+	}
+
+	t.mutex.Lock()
+	t.pid = 0
+	t.paused = false
+	t.finished = time.Now()
+	t.exitCode = exitCode
+	t.mutex.Unlock()
+
+	t.emit(Event{Type: EventFinished, State: t.State(), Err: err})
+
+	return err
+}
+
+// Progress returns a channel receiving a State snapshot every time the state
+// changes during the current run, or the next one when the task isn't running.
+// The channel is closed once rsync exits, or with RunWithRetry once the last
+// attempt has finished. When the consumer falls behind, the
+// oldest snapshots are dropped, so the parser is never blocked
+func (t *Task) Progress() <-chan State {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.progress == nil {
+		t.progress = make(chan State, progressBufferSize)
+	}
+
+	return t.progress
+}
+
+// closeProgress closes the Progress channel of the run. The caller must hold
+// the task mutex
+func (t *Task) closeProgress() {
+	if t.progress != nil {
+		close(t.progress)
+		t.progress = nil
+	}
+}
+
+// notifyProgress sends current state to the Progress channel dropping the
+// oldest snapshot when it's full. The caller must hold the task mutex
+func (t *Task) notifyProgress() {
+	if t.progress == nil {
+		return
+	}
+
+	select {
+	case t.progress <- *t.state:
+	default:
+		select {
+		case <-t.progress:
+		default:
+		}
+		t.progress <- *t.state
+	}
+}
+
+// SetProgressInterval limits how often state changes are delivered to the
+// Progress channel and as EventProgress, to at most once per interval. Every
+// line of rsync output is still parsed and the final state is always
+// delivered. 0, the default, delivers every change
+func (t *Task) SetProgressInterval(interval time.Duration) {
+	t.mutex.Lock()
+	t.progressInterval = interval
+	t.mutex.Unlock()
+}
+
+// SetSpeedWindow sets how many of the last speeds State.SpeedSamples keeps,
+// 10 by default; 0 disables the history
+func (t *Task) SetSpeedWindow(n int) {
+	t.mutex.Lock()
+	t.speedWindow = n
+	if n <= 0 {
+		t.state.SpeedSamples = nil
+	} else if len(t.state.SpeedSamples) > n {
+		t.state.SpeedSamples = append([]float64{}, t.state.SpeedSamples[len(t.state.SpeedSamples)-n:]...)
+	}
+	t.mutex.Unlock()
+}
+
+// progressDue reports whether a state change may be delivered now, remembering
+// the ones held back by the progress interval. The caller must hold the task mutex
+func (t *Task) progressDue() bool {
+	now := time.Now()
+	if t.progressInterval > 0 && now.Sub(t.lastProgress) < t.progressInterval {
+		t.pendingProgress = true
+		return false
+	}
+
+	t.lastProgress = now
+	t.pendingProgress = false
+	return true
+}
+
+// IsRunning reports whether Run, RunContext or RunWithRetry is in progress
+func (t *Task) IsRunning() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.running || t.retrying
+}
+
+// SetPausable allows Pause and Resume from the next run. For this rsync runs
+// in a process group of its own, so its remote shell is paused with it. As a
+// side effect ssh can't prompt for a password on the terminal, and Ctrl-C in
+// the terminal no longer reaches rsync or ssh, so the program has to stop the
+// task itself
+func (t *Task) SetPausable(pausable bool) {
+	t.mutex.Lock()
+	t.rsync.pausable = pausable
+	t.mutex.Unlock()
+}
+
+// Pause stops the running rsync process and its remote shell with SIGSTOP,
+// e.g. to free the bandwidth for a while. The task keeps running: IsRunning
+// stays true and the connections stay open, so a long pause may hit the idle
+// timeouts of ssh, an rsync daemon or Timeout. ErrNotPausable is returned
+// unless SetPausable was enabled before the run, ErrNotRunning when the task
+// isn't running and ErrPauseUnsupported on Windows
+func (t *Task) Pause() error {
+	return t.signalPaused(true, pauseProcess)
+}
+
+// Resume continues the rsync process stopped by Pause with SIGCONT
+func (t *Task) Resume() error {
+	return t.signalPaused(false, resumeProcess)
+}
+
+// IsPaused returns true when the task has been paused and not resumed since
+func (t *Task) IsPaused() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.paused
+}
+
+// signalPaused sends the pause or resume signal and records the new state
+func (t *Task) signalPaused(paused bool, signal func(pid int) error) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	pausable := t.rsync.pausable
+	if t.current != nil {
+		pausable = t.current.pausable
+	}
+	if !pausable {
+		return ErrNotPausable
+	}
+
+	if t.current == nil {
+		return ErrNotRunning
+	}
+
+	if err := signal(t.pid); err != nil {
+		return err
+	}
+	t.paused = paused
+
+	return nil
+}
+
+// PID returns process id of the running rsync, 0 when it isn't running
+func (t *Task) PID() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.pid
+}
+
+// Duration returns how long the last run took, from the start of rsync until
+// it exited. While rsync is running it's the time elapsed so far, before the
+// first run it's 0
+func (t *Task) Duration() time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	switch {
+	case t.started.IsZero():
+		return 0
+	case t.finished.IsZero():
+		return time.Since(t.started)
+	default:
+		return t.finished.Sub(t.started)
+	}
+}
+
+// Reset clears State, Log and Duration left by the previous run, so the task
+// can be run again from scratch. ErrAlreadyRunning is returned when the task is running
+func (t *Task) Reset() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.running || t.retrying {
+		return ErrAlreadyRunning
+	}
+
+	*t.state = State{}
+	t.stdout = logBuffer{}
+	t.stderr = logBuffer{}
+	t.exitCode = 0
+	t.completedBytes = 0
+	t.filesBase = 0
+	t.started = time.Time{}
+	t.finished = time.Time{}
+
+	return nil
+}
+
+// Clone returns a new task with the sources, destination, options and settings
+// of t, such as SetEnv and SetDir, and an empty State and Log. Output writers
+// and callbacks are not copied, the clone starts without them
+func (t *Task) Clone() *Task {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	clone := newTask(t.rsync.Sources, t.rsync.Destination, t.rsync.options.clone())
+	clone.rsync.dir = t.rsync.dir
+	clone.rsync.pausable = t.rsync.pausable
+	if t.rsync.env != nil {
+		clone.rsync.env = map[string]string{}
+		for key, value := range t.rsync.env {
+			clone.rsync.env[key] = value
+		}
+	}
+	clone.progressInterval = t.progressInterval
+	clone.speedWindow = t.speedWindow
+	clone.maxLogBytes = t.maxLogBytes
+	clone.stripControl = t.stripControl
+
+	return clone
+}
+
+// SetSources replaces the sources of the task, e.g. of a Clone. It applies
+// from the next run
+func (t *Task) SetSources(sources ...string) {
+	t.mutex.Lock()
+	t.rsync.Sources = append([]string{}, sources...)
+	t.rsync.Source = ""
+	if len(sources) > 0 {
+		t.rsync.Source = sources[0]
+	}
+	t.mutex.Unlock()
+}
+
+// CommandString returns the command line of the run in progress, or of the
+// next run, quoted for a POSIX shell and redacted like Rsync.Args, e.g. for
+// logging
+func (t *Task) CommandString() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	rsync := t.current
+	if rsync == nil {
+		next := *t.rsync
+		next.cmd = next.newCommand()
+		rsync = &next
+	}
+
+	args := rsync.Args()
+	for i, arg := range args {
+		args[i] = shellQuote(arg)
+	}
+
+	return strings.Join(args, " ")
+}
+
+// shellQuote quotes arg for a POSIX shell unless it's made of safe characters only
+func shellQuote(arg string) string {
+	if arg != "" && shellSafeMatcher.Match(arg) {
+		return arg
+	}
+
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+// Stop terminates the running rsync process: it receives SIGTERM, then SIGKILL
+// after a grace period. Run then returns *RsyncError describing the signal.
+// Stop does nothing when the task isn't running
+func (t *Task) Stop() {
+	t.mutex.Lock()
+	cancel := t.cancel
+	t.mutex.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// retryableExitCodes are rsync exit codes caused by network failures
+var retryableExitCodes = map[int]bool{
+	5:   true, // error starting client-server protocol
+	10:  true, // error in socket I/O
+	12:  true, // error in rsync protocol data stream
+	30:  true, // timeout in data send/receive
+	35:  true, // timeout waiting for daemon connection
+	255: true, // remote shell failed
+}
+
+// RunWithRetry runs the task up to attempts times while rsync fails with an
+// exit code caused by a network failure, e.g. 12 or 30. Other errors are
+// returned immediately. The wait between attempts starts at backoff and
+// doubles after every attempt. Interrupted files are resumed thanks to the
+// forced --partial. State keeps the values of the last attempt until the
+// next one reports progress, TransferredFiles counts the files of all
+// attempts, and Log accumulates the output of all attempts. The Progress
+// channel stays open until the last attempt has finished. The task counts as
+// running for the whole loop, and Stop between attempts skips the remaining
+// ones, returning context.Canceled
+func (t *Task) RunWithRetry(ctx context.Context, attempts int, backoff time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	t.mutex.Lock()
+	if t.running || t.retrying {
+		t.mutex.Unlock()
+		return ErrAlreadyRunning
+	}
+	t.retrying = true
+	t.cancel = cancel
+	t.mutex.Unlock()
+	defer func() {
+		t.mutex.Lock()
+		t.retrying = false
+		t.cancel = nil
+		t.closeProgress()
+		t.mutex.Unlock()
+	}()
+
+	for attempt := 1; ; attempt++ {
+		err := t.runContext(ctx, true)
+
+		var rsyncErr *RsyncError
+		if err == nil || attempt >= attempts || !errors.As(err, &rsyncErr) || !retryableExitCodes[rsyncErr.ExitCode] {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
 }
 
 // NewTask returns new rsync task
 func NewTask(source, destination string, rsyncOptions RsyncOptions) *Task {
+	return NewTaskMulti([]string{source}, destination, rsyncOptions)
+}
+
+// NewTaskMulti returns new rsync task copying several sources into one destination
+func NewTaskMulti(sources []string, destination string, rsyncOptions RsyncOptions) *Task {
 	// Force set required options
 	rsyncOptions.HumanReadable = true
 	rsyncOptions.Partial = true
 	rsyncOptions.Progress = true
 	rsyncOptions.Archive = true
 
+	return newTask(sources, destination, rsyncOptions)
+}
+
+// NewTaskWithOptions returns new rsync task which uses rsyncOptions as given,
+// unlike NewTask it doesn't force Archive, Partial and HumanReadable. Progress
+// is only enabled when rsyncOptions.Info doesn't already pick a progress
+// level, e.g. "progress2", so the State is still updated
+func NewTaskWithOptions(source, destination string, rsyncOptions RsyncOptions) *Task {
+	if !strings.Contains(rsyncOptions.Info, "progress") {
+		rsyncOptions.Progress = true
+	}
+
+	return newTask([]string{source}, destination, rsyncOptions)
+}
+
+func newTask(sources []string, destination string, rsyncOptions RsyncOptions) *Task {
 	return &Task{
-		rsync: NewRsync(source, destination, rsyncOptions),
+		rsync: NewRsyncMulti(sources, destination, rsyncOptions),
 		state: &State{},
-		log:   &Log{},
+
+		speedWindow: defaultSpeedWindow,
 	}
 }
 
@@ -104,52 +746,273 @@ func processStdout(wg *sync.WaitGroup, task *Task, stdout io.Reader) {
 
 	defer wg.Done()
 
-	progressMatcher := newMatcher(`\(.+-chk=(\d+.\d+)`)
-	speedMatcher := newMatcher(`(\d+\.\d+.{2}\/s)`)
+	speedMatcher := newMatcher(`(\d+\.\d+[kMGT]?B\/s)`)
+	percentMatcher := newMatcher(`\s(\d+)%\s`)
+	bytesMatcher := newMatcher(`^\s*([\d,.]+[KMGTP]?)\s+\d+%`)
+	etaMatcher := newMatcher(`\/s\s+(\d+:\d{2}:\d{2})`)
+	// A progress line cut short, e.g. when rsync is killed, is not a file name
+	partialMatcher := newMatcher(`^\s+[\d,.]+[KMGTP]?(\s+\d*%?)?$`)
+	// Lines which are neither progress nor file names
+	noticeMatcher := newMatcher(`^(sending incremental file list|receiving incremental file list|` +
+		`building file list|created directory |deleting |\*deleting|sent .* bytes|total size is|` +
+		`Number of |Total |Literal data|Matched data|File list |` +
+		// and the extra lines of -vv
+		`delta-transmission |total: matches=|\[(?i:sender|receiver|generator)\] |opening connection |` +
+		`.+ is uptodate$|.+ exists$)`)
+
+	// With --info=progress2 the percentage covers the whole transfer, otherwise
+	// it's per file and the overall progress comes from the to-chk counts
+	globalProgress := usesGlobalProgress(task.rsync.options)
 
 	// Extract data from strings:
 	//         999,999 99%  999.99kB/s    0:00:59 (xfr#9, to-chk=999/9999)
-	reader := bufio.NewReader(stdout)
-	for {
-		logStr, err := reader.ReadString('\n')
-		if err != nil {
-			break
-		}
+	//           32768 100%   10.00MB/s    0:00:00 (xfer#1, to-check=1/2)
+	//       1,234,567  45%   10.00MB/s    0:00:12
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineLength)
+	scanner.Split(scanProgressLines)
+	// redraw is the last line ending with a carriage return, which is dropped
+	// from the stripped output once rsync overwrites it
+	redraw := ""
+	// fileStarted is when the name of the file in flight was printed and
+	// doneBytes the overall counter at the previous file done with progress2
+	fileStarted := time.Now()
+	doneBytes := int64(0)
+	for scanner.Scan() {
+		logStr := scanner.Text()
+
+		// Every progress line and file name changes the state
+		isProgress := bytesMatcher.Match(logStr)
+		updated := isProgress
+		events := []Event{}
+		var results []FileResult
 
 		task.mutex.Lock()
 		if progressMatcher.Match(logStr) {
-			task.state.Remain, task.state.Total = getTaskProgress(progressMatcher.Extract(logStr))
+			remain, total, ok := getTaskProgress(progressMatcher.Extract(logStr))
+			if ok {
+				task.state.Remain, task.state.Total = remain, total
+			}
+
+			if ok && !globalProgress {
+				copiedCount := float64(task.state.Total - task.state.Remain)
+				task.state.Progress = copiedCount / math.Max(float64(task.state.Total), float64(minDivider)) * maxPercents
+			}
+		}
+
+		if globalProgress && percentMatcher.Match(logStr) {
+			if percent, err := strconv.ParseFloat(percentMatcher.Extract(logStr), 64); err == nil && percent <= maxPercents {
+				task.state.Progress = percent
+			}
+		}
 
-			copiedCount := float64(task.state.Total - task.state.Remain)
-			task.state.Progress = copiedCount / math.Max(float64(task.state.Total), float64(minDivider)) * maxPercents
+		fileDone := false
+		doneFile := task.state.CurrentFile
+		if fileDoneMatcher.Match(logStr) {
+			transferredFiles, err := strconv.Atoi(fileDoneMatcher.Extract(logStr))
+			if err == nil && task.filesBase+transferredFiles > task.state.TransferredFiles {
+				task.state.TransferredFiles = task.filesBase + transferredFiles
+				fileDone = true
+				events = append(events, Event{Type: EventFileCompleted, File: task.state.CurrentFile})
+			}
+		}
+
+		if isProgress {
+			if fileDoneMatcher.Match(logStr) {
+				task.state.CurrentFile = ""
+			}
+		} else if name := strings.TrimRight(logStr, "\r\n"); name != "" && !noticeMatcher.Match(name) && !partialMatcher.Match(name) {
+			task.state.CurrentFile = name
+			fileStarted = time.Now()
+			updated = true
+		}
+
+		if isProgress {
+			if transferred, err := parseSize(bytesMatcher.Extract(logStr)); err == nil {
+				task.state.Bytes = transferred
+			}
+			if fileDone && !globalProgress {
+				task.completedBytes += task.state.Bytes
+			}
+			if fileDone {
+				size := task.state.Bytes
+				if globalProgress {
+					size, doneBytes = task.state.Bytes-doneBytes, task.state.Bytes
+				}
+				results = append(results, FileResult{Name: doneFile, Size: size, Duration: time.Since(fileStarted)})
+			}
 		}
 
 		if speedMatcher.Match(logStr) {
 			task.state.Speed = getTaskSpeed(speedMatcher.ExtractAllStringSubmatch(logStr, 2))
+			task.state.SpeedBytesPerSec = parseSpeed(task.state.Speed)
+			task.state.SpeedSamples = appendSample(task.state.SpeedSamples, task.state.SpeedBytesPerSec, task.speedWindow)
+
+			// Once a file is done rsync prints the elapsed time in place of the ETA
+			if fileDoneMatcher.Match(logStr) {
+				task.state.ETA = 0
+			} else if etaMatcher.Match(logStr) {
+				task.state.ETA = getTaskETA(etaMatcher.Extract(logStr))
+			}
+		}
+
+		if isProgress {
+			task.state.OverallETA = estimateOverallETA(*task.state, task.state.TransferredFiles-task.filesBase, task.completedBytes, globalProgress)
+		}
+
+		if updated && task.progressDue() {
+			task.notifyProgress()
+			events = append(events, Event{Type: EventProgress})
+		}
+		for i := range events {
+			events[i].State = *task.state
+		}
+
+		output := logStr
+		if task.stripControl {
+			output, redraw = "", ""
+			if strings.HasSuffix(logStr, "\r") {
+				redraw = stripControlChars(logStr)
+			} else {
+				output = stripControlChars(logStr)
+			}
 		}
 
-		task.log.Stdout += logStr + "\n"
+		task.stdout.append(output, task.maxLogBytes)
+		writer := task.stdoutWriter
+		combined := task.combined
+		onFileComplete := task.onFileComplete
 		task.mutex.Unlock()
+
+		if writer != nil && output != "" {
+			io.WriteString(writer, output)
+		}
+		if combined != nil && output != "" {
+			combined.writeLine("stdout", output)
+		}
+		task.emit(events...)
+		if onFileComplete != nil {
+			for _, result := range results {
+				onFileComplete(result)
+			}
+		}
 	}
+
+	// Deliver the last state held back by the progress interval and the
+	// redraw nothing has overwritten
+	task.mutex.Lock()
+	task.stdout.append(redraw, task.maxLogBytes)
+	writer := task.stdoutWriter
+	combined := task.combined
+	events := []Event{}
+	if task.pendingProgress {
+		task.pendingProgress = false
+		task.notifyProgress()
+		events = append(events, Event{Type: EventProgress, State: *task.state})
+	}
+	task.mutex.Unlock()
+
+	if writer != nil && redraw != "" {
+		io.WriteString(writer, redraw)
+	}
+	if combined != nil && redraw != "" {
+		combined.writeLine("stdout", redraw)
+	}
+	task.emit(events...)
+
+	// Keep draining so rsync never blocks on a full pipe
+	io.Copy(ioutil.Discard, stdout)
 }
 
 func processStderr(wg *sync.WaitGroup, task *Task, stderr io.Reader) {
 	defer wg.Done()
 
+	// Extract data from strings:
+	//     rsync: [sender] link_stat "/src/a" failed: No such file or directory (2)
+	//     rsync error: some files/attrs were not transferred (see previous errors) (code 23) at main.c(1338)
+	errorMatcher := newMatcher(`^rsync( error)?: `)
+
 	reader := bufio.NewReader(stderr)
 	for {
 		logStr, err := reader.ReadString('\n')
+		if logStr != "" {
+			task.mutex.Lock()
+			if task.stripControl {
+				logStr = stripControlChars(logStr)
+			}
+			task.stderr.append(logStr, task.maxLogBytes)
+			writer := task.stderrWriter
+			combined := task.combined
+			handler := task.onStderrLine
+			state := *task.state
+			task.mutex.Unlock()
+
+			if writer != nil {
+				io.WriteString(writer, logStr)
+			}
+			if combined != nil {
+				combined.writeLine("stderr", logStr)
+			}
+
+			line := strings.TrimRight(logStr, "\n")
+			if handler != nil {
+				handler(line)
+			}
+
+			if errorMatcher.Match(logStr) {
+				task.emit(Event{Type: EventError, State: state, Message: line})
+			}
+		}
+
 		if err != nil {
 			break
 		}
+	}
+}
 
-		task.mutex.Lock()
-		task.log.Stderr += logStr + "\n"
-		task.mutex.Unlock()
+// escapeMatcher matches ANSI CSI and OSC sequences, e.g. colors and titles
+var escapeMatcher = newMatcher(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)|\x1b[@-_]`)
+
+// stripControlChars removes ANSI escape sequences and control characters but
+// newlines and tabs from s
+func stripControlChars(s string) string {
+	s = escapeMatcher.regExp.ReplaceAllString(s, "")
+
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' || (r >= ' ' && r != 0x7f) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// usesGlobalProgress reports whether rsync prints whole-transfer progress lines
+func usesGlobalProgress(options RsyncOptions) bool {
+	return strings.Contains(options.Info, "progress2")
+}
+
+// scanProgressLines is a bufio.SplitFunc which splits rsync output on both
+// '\n' and '\r', as rsync redraws progress lines with a carriage return.
+// Returned tokens keep their terminating character
+func scanProgressLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
 	}
+
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i+1], nil
+	}
+
+	if atEOF {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
 }
 
-func getTaskProgress(remTotalString string) (int, int) {
+// getTaskProgress parses the "remain/total" counts of to-chk and ir-chk; ok is
+// false when they are malformed, e.g. cut short
+func getTaskProgress(remTotalString string) (remain, total int, ok bool) {
 	const remTotalSeparator = "/"
 	const numbersCount = 2
 	const (
@@ -158,20 +1021,132 @@ func getTaskProgress(remTotalString string) (int, int) {
 	)
 
 	info := strings.Split(remTotalString, remTotalSeparator)
-	if len(info) < numbersCount {
-		return 0, 0
+	if len(info) != numbersCount {
+		return 0, 0, false
 	}
 
-	remain, _ := strconv.Atoi(info[indexRem])
-	total, _ := strconv.Atoi(info[indexTotal])
+	remain, err := strconv.Atoi(info[indexRem])
+	if err != nil {
+		return 0, 0, false
+	}
+	total, err = strconv.Atoi(info[indexTotal])
+	if err != nil || remain > total {
+		return 0, 0, false
+	}
 
-	return remain, total
+	return remain, total, true
 }
 
 func getTaskSpeed(data [][]string) string {
-	if len(data) < 2 || len(data[1]) < 2 {
+	if len(data) == 0 || len(data[len(data)-1]) < 2 {
 		return ""
 	}
 
-	return data[1][1]
+	return data[len(data)-1][1]
+}
+
+// speedUnits are the units rsync uses for speed in progress lines. rsync
+// divides the rate by 1024 for each unit despite the "kB" spelling
+var speedUnits = []string{"B/s", "kB/s", "MB/s", "GB/s", "TB/s"}
+
+// estimateOverallETA returns the time left for the whole transfer at the mean
+// speed of the samples, or 0 when it can't be estimated yet
+func estimateOverallETA(state State, completedFiles int, completedBytes int64, globalProgress bool) time.Duration {
+	speed := state.SpeedBytesPerSec
+	if len(state.SpeedSamples) > 0 {
+		speed = 0
+		for _, sample := range state.SpeedSamples {
+			speed += sample
+		}
+		speed /= float64(len(state.SpeedSamples))
+	}
+	if speed <= 0 {
+		return 0
+	}
+
+	remaining := float64(0)
+	if globalProgress {
+		// Progress is the share of all bytes that Bytes stands for
+		if state.Progress <= 0 {
+			return 0
+		}
+		remaining = float64(state.Bytes) * (100 - state.Progress) / state.Progress
+	} else {
+		if completedFiles <= 0 {
+			return 0
+		}
+		remaining = float64(completedBytes) / float64(completedFiles) * float64(state.Remain)
+	}
+
+	return time.Duration(remaining / speed * float64(time.Second))
+}
+
+// appendSample returns samples with value appended, keeping at most the last
+// window of them. The result is a new slice, so copies of State handed out
+// earlier never change
+func appendSample(samples []float64, value float64, window int) []float64 {
+	if window <= 0 {
+		return nil
+	}
+
+	if len(samples) >= window {
+		samples = samples[len(samples)-window+1:]
+	}
+	result := make([]float64, 0, len(samples)+1)
+	result = append(result, samples...)
+
+	return append(result, value)
+}
+
+// parseSpeed converts speed printed by rsync, e.g. "10.00MB/s", into bytes per second
+func parseSpeed(speed string) float64 {
+	for index := len(speedUnits) - 1; index >= 0; index-- {
+		if strings.HasSuffix(speed, speedUnits[index]) {
+			value, err := strconv.ParseFloat(strings.TrimSuffix(speed, speedUnits[index]), 64)
+			if err != nil {
+				return 0
+			}
+
+			for ; index > 0; index-- {
+				value *= 1024
+			}
+			return value
+		}
+	}
+
+	return 0
+}
+
+// formatSpeed prints bytes per second the way rsync does
+func formatSpeed(bytesPerSec float64) string {
+	index := 1
+	value := bytesPerSec / 1024
+	for value >= 1024 && index < len(speedUnits)-1 {
+		value /= 1024
+		index++
+	}
+
+	return fmt.Sprintf("%.2f%s", value, speedUnits[index])
+}
+
+// getTaskETA converts rsync's H:MM:SS time field into a duration
+func getTaskETA(timeString string) time.Duration {
+	const timeSeparator = ":"
+	const partsCount = 3
+
+	parts := strings.Split(timeString, timeSeparator)
+	if len(parts) != partsCount {
+		return 0
+	}
+
+	eta := time.Duration(0)
+	for _, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+		eta = eta*60 + time.Duration(value)
+	}
+
+	return eta * time.Second
 }
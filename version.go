@@ -0,0 +1,70 @@
+package grsync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// RsyncVersion is a version of the rsync binary
+type RsyncVersion struct {
+	Major int `json:"major"`
+	Minor int `json:"minor"`
+	Patch int `json:"patch"`
+}
+
+// String returns version in the MAJOR.MINOR.PATCH form
+func (v RsyncVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast reports whether v is the same as or newer than major.minor.patch
+func (v RsyncVersion) AtLeast(major, minor, patch int) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+
+	if v.Minor != minor {
+		return v.Minor > minor
+	}
+
+	return v.Patch >= patch
+}
+
+// Version returns version of the rsync found in PATH
+func Version() (RsyncVersion, error) {
+	return getVersion("rsync")
+}
+
+func getVersion(binaryPath string) (RsyncVersion, error) {
+	output, err := exec.Command(binaryPath, "--version").Output()
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			return RsyncVersion{}, fmt.Errorf("rsync is not installed: %w", err)
+		}
+		return RsyncVersion{}, fmt.Errorf("can't get rsync version: %w", err)
+	}
+
+	return parseVersion(string(output))
+}
+
+func parseVersion(output string) (RsyncVersion, error) {
+	// Extract data from strings:
+	//     rsync  version 3.1.3  protocol version 31
+	//     rsync  version v3.2.7  protocol version 31
+	versionMatcher := newMatcher(`rsync\s+version\s+v?(\d+)\.(\d+)\.(\d+)`)
+
+	matches := versionMatcher.ExtractAllStringSubmatch(output, 1)
+	if len(matches) == 0 {
+		return RsyncVersion{}, fmt.Errorf("can't find rsync version in %q", output)
+	}
+
+	// The pattern only matches digits, so conversion can't fail
+	major, _ := strconv.Atoi(matches[0][1])
+	minor, _ := strconv.Atoi(matches[0][2])
+	patch, _ := strconv.Atoi(matches[0][3])
+
+	return RsyncVersion{Major: major, Minor: minor, Patch: patch}, nil
+}
@@ -0,0 +1,54 @@
+package grsync
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersion(t *testing.T) {
+	t.Run("release versions", func(t *testing.T) {
+		for output, expected := range map[string]RsyncVersion{
+			"rsync  version 2.6.9  protocol version 29\nCopyright (C) 1996-2006 by Andrew Tridgell, Wayne Davison, and others.\n": {2, 6, 9},
+			"rsync  version 3.1.3  protocol version 31\n":  {3, 1, 3},
+			"rsync  version v3.2.7  protocol version 31\n": {3, 2, 7},
+			"rsync  version 3.2.4dev  protocol version 31": {3, 2, 4},
+		} {
+			version, err := parseVersion(output)
+			assert.Nil(t, err)
+			assert.Equal(t, expected, version)
+		}
+	})
+
+	t.Run("unexpected output", func(t *testing.T) {
+		_, err := parseVersion("openrsync: protocol version 29")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestVersionString(t *testing.T) {
+	assert.Equal(t, "3.2.7", RsyncVersion{3, 2, 7}.String())
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	version := RsyncVersion{3, 1, 3}
+	assert.True(t, version.AtLeast(3, 1, 3))
+	assert.True(t, version.AtLeast(3, 1, 0))
+	assert.True(t, version.AtLeast(2, 6, 9))
+	assert.False(t, version.AtLeast(3, 2, 3))
+	assert.False(t, version.AtLeast(4, 0, 0))
+}
+
+func TestGetVersion(t *testing.T) {
+	t.Run("fake rsync", func(t *testing.T) {
+		version, err := getVersion(fakeRsync(t, `echo "rsync  version 3.2.3  protocol version 31"`))
+		assert.Nil(t, err)
+		assert.Equal(t, RsyncVersion{3, 2, 3}, version)
+	})
+
+	t.Run("missing rsync", func(t *testing.T) {
+		_, err := getVersion("/nonexistent/rsync")
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "not installed")
+	})
+}